@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestProcessWithRetentionRetryWhileInFlight проверяет гонку, которую
+// когда-то ловил один общий канал в s.responses: если задача с этим ID уже
+// Pending/Active, повторный вызов ProcessWithRetention должен подписаться
+// на тот же результат, а не создать вторую задачу и потерять одного из
+// ожидающих.
+func TestProcessWithRetentionRetryWhileInFlight(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTaskStore()
+	if err := store.Save(ctx, &TaskInfo{
+		ID:        "retry-in-flight",
+		UserID:    "u1",
+		Status:    TaskPending,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		t.Fatalf("не удалось создать задачу: %v", err)
+	}
+
+	support := NewAISupport(NewSupportAgent(NewNLPProcessor(), NewKnowledgeBase()), 1, store)
+	query := Query{ID: "retry-in-flight", UserID: "u1", Text: "неважно"}
+
+	const callers = 3
+	var wg sync.WaitGroup
+	responses := make([]Response, callers)
+	errs := make([]error, callers)
+
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i], errs[i] = support.ProcessWithRetention(ctx, query, time.Second, defaultTaskRetention)
+		}(i)
+	}
+
+	// Даём всем вызовам время дойти до идемпотентной ветки и
+	// зарегистрироваться в качестве ожидающих, прежде чем "воркер"
+	// доставит результат.
+	time.Sleep(50 * time.Millisecond)
+
+	want := Response{QueryID: query.ID, Text: "готовый ответ", Source: "ai"}
+	support.deliverResponse(query.ID, want)
+
+	wg.Wait()
+
+	for i := range responses {
+		if errs[i] != nil {
+			t.Fatalf("вызов %d вернул ошибку: %v", i, errs[i])
+		}
+		if responses[i].Text != want.Text {
+			t.Errorf("вызов %d получил %q, хотели %q - повторный вызов не должен был потерять ожидающего", i, responses[i].Text, want.Text)
+		}
+	}
+
+	tasks, err := store.List(ctx, TaskFilter{UserID: "u1"})
+	if err != nil {
+		t.Fatalf("не удалось получить список задач: %v", err)
+	}
+	if len(tasks) != 1 {
+		t.Fatalf("повторные вызовы не должны создавать новую задачу, получили %d", len(tasks))
+	}
+}
+
+func TestDeliverResponseNotifiesAllWaiters(t *testing.T) {
+	support := NewAISupport(NewSupportAgent(NewNLPProcessor(), NewKnowledgeBase()), 1, NewMemoryTaskStore())
+
+	const waiterCount = 3
+	waiters := make([]chan Response, waiterCount)
+	for i := range waiters {
+		waiters[i] = support.registerWaiter("shared-id")
+	}
+
+	want := Response{QueryID: "shared-id", Text: "готово", Source: "ai"}
+	support.deliverResponse("shared-id", want)
+
+	for i, ch := range waiters {
+		select {
+		case got := <-ch:
+			if got.Text != want.Text {
+				t.Errorf("ожидающий %d получил %q, хотели %q", i, got.Text, want.Text)
+			}
+		default:
+			t.Errorf("ожидающий %d не получил ответ", i)
+		}
+	}
+}
+
+func TestUnregisterWaiterRemovesOnlyItself(t *testing.T) {
+	support := NewAISupport(NewSupportAgent(NewNLPProcessor(), NewKnowledgeBase()), 1, NewMemoryTaskStore())
+
+	first := support.registerWaiter("shared-id")
+	second := support.registerWaiter("shared-id")
+
+	support.unregisterWaiter("shared-id", first)
+	support.deliverResponse("shared-id", Response{QueryID: "shared-id", Text: "готово"})
+
+	select {
+	case <-first:
+		t.Fatal("отписавшийся ожидающий не должен получить ответ")
+	default:
+	}
+
+	select {
+	case got := <-second:
+		if got.Text != "готово" {
+			t.Errorf("получили %q, хотели %q", got.Text, "готово")
+		}
+	default:
+		t.Fatal("оставшийся ожидающий должен получить ответ")
+	}
+}
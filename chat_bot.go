@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// ChatHistory хранит реплики одного пользователя для многоходовых диалогов.
+type ChatHistory struct {
+	UserID   string
+	Messages []string
+}
+
+func (h *ChatHistory) append(role, text string) {
+	h.Messages = append(h.Messages, fmt.Sprintf("%s: %s", role, text))
+}
+
+// Bot - REPL-обёртка над AISupport, поддерживающая историю диалога
+// для каждого пользователя отдельно.
+type Bot struct {
+	support   *AISupport
+	historyMu sync.Mutex
+	history   map[string]*ChatHistory
+}
+
+func NewBot(support *AISupport) *Bot {
+	return &Bot{
+		support: support,
+		history: make(map[string]*ChatHistory),
+	}
+}
+
+func (b *Bot) historyFor(userID string) *ChatHistory {
+	b.historyMu.Lock()
+	defer b.historyMu.Unlock()
+
+	h, ok := b.history[userID]
+	if !ok {
+		h = &ChatHistory{UserID: userID}
+		b.history[userID] = h
+	}
+	return h
+}
+
+// Loop запускает REPL в консоли: читает строки от пользователя,
+// прогоняет их через AISupport и печатает ответ.
+func (b *Bot) Loop(ctx context.Context, userID string) error {
+	scanner := bufio.NewScanner(os.Stdin)
+	history := b.historyFor(userID)
+
+	fmt.Println("Чат-бот поддержки. Введите сообщение (или 'exit' для выхода).")
+
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			return scanner.Err()
+		}
+
+		text := scanner.Text()
+		if text == "exit" {
+			return nil
+		}
+
+		query := Query{
+			ID:      fmt.Sprintf("%s-%d", userID, len(history.Messages)),
+			UserID:  userID,
+			Text:    text,
+			History: append([]string(nil), history.Messages...),
+		}
+		history.append("user", text)
+
+		resp, err := b.support.Process(query, defaultProcessTimeout)
+		if err != nil {
+			log.Printf("чат-бот: ошибка обработки запроса %s: %v", query.ID, err)
+			fmt.Println("Извините, произошла ошибка. Попробуйте ещё раз.")
+			continue
+		}
+
+		if resp.Stream != nil {
+			var full string
+			for token := range resp.Stream {
+				fmt.Print(token)
+				full += token
+			}
+			fmt.Println()
+			history.append("assistant", full)
+			continue
+		}
+
+		fmt.Println(resp.Text)
+		history.append("assistant", resp.Text)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -26,18 +28,24 @@ type Query struct {
 	ID     string
 	UserID string
 	Text   string
+	// History - предыдущие реплики этого пользователя (в хронологическом
+	// порядке, без текущей), нужны LLM-фолбэку для многоходовых диалогов.
+	History []string
 }
 
 type Response struct {
 	QueryID string
 	Text    string
-	Source  string // "ai" или "human"
+	Source  string        // "ai", "llm" или "human"
+	Stream  <-chan string `json:"-"`
+	Latency time.Duration
 }
 
 // Упрощенная база знаний
 type KnowledgeBase struct {
-	answers map[Intent]string
-	mu      sync.RWMutex
+	answers  map[Intent]string
+	starters map[Intent][]string
+	mu       sync.RWMutex
 }
 
 func NewKnowledgeBase() *KnowledgeBase {
@@ -49,10 +57,56 @@ func NewKnowledgeBase() *KnowledgeBase {
 			IntentTechnical: "Для технических вопросов уточните, с какой функцией у вас проблемы.",
 			IntentBilling:   "По вопросам счетов обратитесь в финансовый отдел.",
 		},
+		starters: map[Intent][]string{
+			IntentPricing:   {"Вы предоставляете скидки при годовой оплате?", "Что входит в премиум-тариф?"},
+			IntentTechnical: {"Как посмотреть журнал ошибок?", "Как связаться с технической поддержкой напрямую?"},
+			IntentBilling:   {"Как изменить способ оплаты?", "Где посмотреть историю платежей?"},
+			IntentHelp:      {"Расскажите подробнее о тарифах", "Что делать при технической проблеме?"},
+		},
 	}
 	return kb
 }
 
+// Context собирает записи базы знаний в текст, пригодный для
+// использования в качестве системного промпта языковой модели.
+func (kb *KnowledgeBase) Context() string {
+	kb.mu.RLock()
+	defer kb.mu.RUnlock()
+
+	var sb strings.Builder
+	sb.WriteString("База знаний службы поддержки:\n")
+	for intent, answer := range kb.answers {
+		sb.WriteString(fmt.Sprintf("- %s: %s\n", intent, answer))
+	}
+	return sb.String()
+}
+
+// Starters возвращает сохранённые заготовки follow-up вопросов для
+// указанного интента.
+func (kb *KnowledgeBase) Starters(intent Intent) []string {
+	kb.mu.RLock()
+	defer kb.mu.RUnlock()
+
+	starters := kb.starters[intent]
+	result := make([]string, len(starters))
+	copy(result, starters)
+	return result
+}
+
+// AddStarter добавляет один вариант follow-up вопроса для интента.
+func (kb *KnowledgeBase) AddStarter(intent Intent, text string) {
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	kb.starters[intent] = append(kb.starters[intent], text)
+}
+
+// SetStarters полностью заменяет список follow-up вопросов для интента.
+func (kb *KnowledgeBase) SetStarters(intent Intent, starters []string) {
+	kb.mu.Lock()
+	defer kb.mu.Unlock()
+	kb.starters[intent] = starters
+}
+
 func (kb *KnowledgeBase) GetAnswer(intent Intent) string {
 	kb.mu.RLock()
 	defer kb.mu.RUnlock()
@@ -63,69 +117,229 @@ func (kb *KnowledgeBase) GetAnswer(intent Intent) string {
 	return "Извините, я не могу ответить на этот вопрос."
 }
 
-// Упрощенный NLP процессор
+// Упрощенный NLP процессор. Вместо первого совпавшего ключевого слова
+// считает взвешенный скор по всем интентам - подробности в
+// DetectIntentScored.
 type NLPProcessor struct {
-	keywords map[string]Intent
+	mu       sync.RWMutex
+	keywords map[string]*keywordWeight
+
+	negationWords map[string]bool
+	// negationWindow - сколько токенов перед ключевым словом проверяется
+	// на наличие отрицания.
+	negationWindow int
+	// negationPenalty - множитель веса негированного совпадения. При
+	// значении -1.0 совпадение полностью меняет знак вклада на
+	// противоположный, так что негированное ключевое слово никогда не
+	// может увеличить скор интента, вне зависимости от своего веса.
+	negationPenalty float64
+	bigramBoost     float64
+
+	scoreThreshold  float64
+	marginThreshold float64
+}
+
+// keywordWeight хранит интент и вес одного ключевого слова/фразы.
+type keywordWeight struct {
+	intent Intent
+	weight float64
 }
 
 func NewNLPProcessor() *NLPProcessor {
-	return &NLPProcessor{
-		keywords: map[string]Intent{
-			"привет":       IntentGreeting,
-			"здравствуй":   IntentGreeting,
-			"здравствуйте": IntentGreeting,
-			"добрый день":  IntentGreeting,
-			"доброе утро":  IntentGreeting,
-			"добрый вечер": IntentGreeting,
-
-			"помощь":    IntentHelp,
-			"помоги":    IntentHelp,
-			"помогите":  IntentHelp,
-			"поддержка": IntentHelp,
-
-			"цена":      IntentPricing,
-			"стоимость": IntentPricing,
-			"тариф":     IntentPricing,
-			"стоит":     IntentPricing,
-			"план":      IntentPricing,
-
-			"проблема":    IntentTechnical,
-			"ошибка":      IntentTechnical,
-			"не работает": IntentTechnical,
-			"сломалось":   IntentTechnical,
-			"техническая": IntentTechnical,
-			"технический": IntentTechnical,
-			"баг":         IntentTechnical,
-
-			"счет":   IntentBilling,
-			"оплата": IntentBilling,
-			"счёт":   IntentBilling,
-			"платеж": IntentBilling,
-			"платёж": IntentBilling,
-			"деньги": IntentBilling,
+	p := &NLPProcessor{
+		keywords: make(map[string]*keywordWeight),
+		negationWords: map[string]bool{
+			"не": true,
 		},
+		negationWindow:  2,
+		negationPenalty: -1.0,
+		bigramBoost:     1.5,
+		scoreThreshold:  0.2,
+		marginThreshold: 0.05,
 	}
+
+	for keyword, intent := range map[string]Intent{
+		"привет":       IntentGreeting,
+		"здравствуй":   IntentGreeting,
+		"здравствуйте": IntentGreeting,
+		"добрый день":  IntentGreeting,
+		"доброе утро":  IntentGreeting,
+		"добрый вечер": IntentGreeting,
+
+		"помощь":    IntentHelp,
+		"помоги":    IntentHelp,
+		"помогите":  IntentHelp,
+		"поддержка": IntentHelp,
+
+		"цена":      IntentPricing,
+		"стоимость": IntentPricing,
+		"тариф":     IntentPricing,
+		"стоит":     IntentPricing,
+		"план":      IntentPricing,
+
+		"проблема":    IntentTechnical,
+		"ошибка":      IntentTechnical,
+		"не работает": IntentTechnical,
+		"сломалось":   IntentTechnical,
+		"техническая": IntentTechnical,
+		"технический": IntentTechnical,
+		"баг":         IntentTechnical,
+
+		"счет":   IntentBilling,
+		"оплата": IntentBilling,
+		"счёт":   IntentBilling,
+		"платеж": IntentBilling,
+		"платёж": IntentBilling,
+		"деньги": IntentBilling,
+	} {
+		p.keywords[keyword] = &keywordWeight{intent: intent, weight: 1.0}
+	}
+
+	return p
+}
+
+// IntentScore - одна строка из ранжированного результата DetectIntentScored.
+type IntentScore struct {
+	Intent     Intent
+	Confidence float64
 }
 
+// KeywordWeight - сериализуемое представление одного ключевого слова,
+// используемое для сохранения и загрузки подобранных весов.
+type KeywordWeight struct {
+	Keyword string
+	Intent  Intent
+	Weight  float64
+}
+
+// AddKeyword добавляет или переопределяет вес ключевого слова/фразы для
+// интента - так веса можно подстраивать по данным из журнала запросов.
+func (p *NLPProcessor) AddKeyword(keyword string, intent Intent, weight float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keywords[strings.ToLower(keyword)] = &keywordWeight{intent: intent, weight: weight}
+}
+
+// ExportWeights возвращает текущие веса ключевых слов для персистентности.
+func (p *NLPProcessor) ExportWeights() []KeywordWeight {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	weights := make([]KeywordWeight, 0, len(p.keywords))
+	for keyword, kw := range p.keywords {
+		weights = append(weights, KeywordWeight{Keyword: keyword, Intent: kw.intent, Weight: kw.weight})
+	}
+	return weights
+}
+
+// ImportWeights заменяет веса ключевых слов ранее сохранёнными значениями.
+func (p *NLPProcessor) ImportWeights(weights []KeywordWeight) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, w := range weights {
+		p.keywords[strings.ToLower(w.Keyword)] = &keywordWeight{intent: w.Intent, weight: w.Weight}
+	}
+}
+
+// DetectIntentScored считает скор каждого интента как сумму весов
+// совпавших ключевых слов, делённую на число токенов запроса. Биграммы
+// (фразы из нескольких слов) получают bigramBoost, а вес ключевых слов,
+// оказавшихся в пределах negationWindow токенов после слова отрицания
+// (например, "не"), умножается на negationPenalty - это переворачивает
+// знак вклада, а не просто уменьшает его, так что "не помощь" не может
+// набрать положительный скор по IntentHelp. Результат отсортирован по
+// убыванию уверенности.
+func (p *NLPProcessor) DetectIntentScored(text string) []IntentScore {
+	normalized := strings.ToLower(text)
+	tokenCount := len(strings.Fields(normalized))
+	if tokenCount == 0 {
+		tokenCount = 1
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	scores := make(map[Intent]float64)
+	for keyword, kw := range p.keywords {
+		idx := strings.Index(normalized, keyword)
+		if idx == -1 {
+			continue
+		}
+
+		weight := kw.weight
+		if strings.Contains(keyword, " ") {
+			weight *= p.bigramBoost
+		}
+		if p.isNegated(normalized, idx) {
+			weight *= p.negationPenalty
+		}
+
+		scores[kw.intent] += weight
+	}
+
+	result := make([]IntentScore, 0, len(scores))
+	for intent, score := range scores {
+		result = append(result, IntentScore{Intent: intent, Confidence: score / float64(tokenCount)})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Confidence > result[j].Confidence
+	})
+
+	return result
+}
+
+// isNegated проверяет, встречается ли слово отрицания среди
+// negationWindow токенов, предшествующих найденному ключевому слову.
+func (p *NLPProcessor) isNegated(text string, keywordStart int) bool {
+	prefixTokens := strings.Fields(text[:keywordStart])
+
+	start := 0
+	if len(prefixTokens) > p.negationWindow {
+		start = len(prefixTokens) - p.negationWindow
+	}
+
+	for _, token := range prefixTokens[start:] {
+		if p.negationWords[token] {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectIntent возвращает единственный наиболее вероятный интент, либо
+// IntentUnknown, если уверенность ниже scoreThreshold или топ-2 интента
+// слишком близки друг к другу (неоднозначный запрос).
 func (p *NLPProcessor) DetectIntent(text string) Intent {
-	text = strings.ToLower(text)
 	log.Printf("Определяем интент для запроса: %s", text)
 
-	for keyword, intent := range p.keywords {
-		if strings.Contains(text, keyword) {
-			log.Printf("Найдено ключевое слово '%s', определен интент: %s", keyword, intent)
-			return intent
-		}
+	scores := p.DetectIntentScored(text)
+	if len(scores) == 0 {
+		log.Printf("Интент не определен, запрос будет направлен оператору")
+		return IntentUnknown
+	}
+
+	top := scores[0]
+	if top.Confidence < p.scoreThreshold {
+		log.Printf("Лучший интент %s набрал %.2f < порога %.2f, считаем неизвестным", top.Intent, top.Confidence, p.scoreThreshold)
+		return IntentUnknown
+	}
+	if len(scores) > 1 && top.Confidence-scores[1].Confidence < p.marginThreshold {
+		log.Printf("Интенты %s (%.2f) и %s (%.2f) слишком близки, считаем запрос неоднозначным",
+			top.Intent, top.Confidence, scores[1].Intent, scores[1].Confidence)
+		return IntentUnknown
 	}
 
-	log.Printf("Интент не определен, запрос будет направлен оператору")
-	return IntentUnknown
+	log.Printf("Определен интент: %s (уверенность %.2f)", top.Intent, top.Confidence)
+	return top.Intent
 }
 
 // Агент поддержки
 type SupportAgent struct {
 	nlp             *NLPProcessor
 	kb              *KnowledgeBase
+	llm             Model
 	humanQueue      chan Query
 	maxHumanQueries int
 }
@@ -139,40 +353,155 @@ func NewSupportAgent(nlp *NLPProcessor, kb *KnowledgeBase) *SupportAgent {
 	}
 }
 
-func (a *SupportAgent) ProcessQuery(query Query) Response {
+// WithModel подключает языковую модель, используемую как фолбэк для
+// запросов с неизвестным интентом.
+func (a *SupportAgent) WithModel(llm Model) *SupportAgent {
+	a.llm = llm
+	return a
+}
+
+func (a *SupportAgent) ProcessQuery(ctx context.Context, query Query) Response {
+	_, resp := a.ProcessQueryWithIntent(ctx, query)
+	return resp
+}
+
+// ProcessQueryWithIntent делает то же самое, что и ProcessQuery, но также
+// возвращает определённый интент - чтобы вызывающий код (worker,
+// записывающий этот же интент в журнал запросов) не гонял NLP повторно по
+// тому же тексту и не мог разойтись с интентом, на который реально был дан
+// ответ, если веса ключевых слов поменялись между двумя вызовами.
+func (a *SupportAgent) ProcessQueryWithIntent(ctx context.Context, query Query) (Intent, Response) {
 	intent := a.nlp.DetectIntent(query.Text)
 
-	// Если интент неизвестен, передаем человеку
+	// Если интент неизвестен, сначала пробуем языковую модель
 	if intent == IntentUnknown {
-		select {
-		case a.humanQueue <- query:
-			log.Printf("Запрос %s передан человеку-оператору", query.ID)
-			return Response{
-				QueryID: query.ID,
-				Text:    "Ваш запрос передан специалисту поддержки.",
-				Source:  "human",
-			}
-		default:
-			log.Printf("Очередь к оператору заполнена, отправляем стандартный ответ")
-			return Response{
-				QueryID: query.ID,
-				Text:    "Все операторы заняты. Попробуйте переформулировать вопрос.",
-				Source:  "ai",
+		if a.llm != nil {
+			if resp, ok := a.tryModel(ctx, query); ok {
+				return intent, resp
 			}
 		}
+		return intent, a.escalateToHuman(query)
 	}
 
 	// Возвращаем ответ из базы знаний
 	answer := a.kb.GetAnswer(intent)
 	log.Printf("На запрос %s найден ответ по интенту %s: %s", query.ID, intent, answer)
 
-	return Response{
+	return intent, Response{
 		QueryID: query.ID,
 		Text:    answer,
 		Source:  "ai",
 	}
 }
 
+// tryModel обращается к языковой модели с контекстом базы знаний и
+// возвращает true, если ответ достаточно уверенный, чтобы не эскалировать.
+// buildPrompt собирает системный промпт для LLM-фолбэка: контекст базы
+// знаний, историю диалога пользователя (для многоходовых разговоров) и
+// текущий вопрос.
+func (a *SupportAgent) buildPrompt(query Query) string {
+	var sb strings.Builder
+	sb.WriteString(a.kb.Context())
+
+	if len(query.History) > 0 {
+		sb.WriteString("\nИстория диалога:\n")
+		for _, line := range query.History {
+			sb.WriteString(line)
+			sb.WriteString("\n")
+		}
+	}
+
+	sb.WriteString(fmt.Sprintf("\nВопрос пользователя: %s", query.Text))
+	return sb.String()
+}
+
+// tryModel обращается к языковой модели и эскалирует запрос человеку,
+// если модель ответила с ошибкой или её ответ выглядит неуверенным
+// (ModelConfidence ниже lowConfidenceThreshold).
+func (a *SupportAgent) tryModel(ctx context.Context, query Query) (Response, bool) {
+	prompt := a.buildPrompt(query)
+
+	text, err := a.llm.Generate(ctx, prompt)
+	if err != nil {
+		log.Printf("llm: ошибка при обработке запроса %s: %v", query.ID, err)
+		return Response{}, false
+	}
+
+	result := ModelConfidence{Text: text, Confidence: estimateConfidence(text)}
+	if result.Confidence < lowConfidenceThreshold {
+		log.Printf("llm: низкая уверенность (%.2f) в ответе на запрос %s, эскалируем оператору", result.Confidence, query.ID)
+		return Response{}, false
+	}
+
+	return Response{
+		QueryID: query.ID,
+		Source:  "llm",
+		Stream:  streamFromText(result.Text),
+	}, true
+}
+
+// PromptStarters возвращает до limit (1-10) предлагаемых follow-up
+// вопросов для интента: сначала детерминированные заготовки из базы
+// знаний, затем, если есть языковая модель и заготовок не хватает,
+// дополнительные варианты от неё.
+func (a *SupportAgent) PromptStarters(ctx context.Context, intent Intent, limit int) ([]string, error) {
+	if limit < 1 || limit > 10 {
+		return nil, fmt.Errorf("limit должен быть в диапазоне 1-10, получено %d", limit)
+	}
+
+	starters := a.kb.Starters(intent)
+	if len(starters) > limit {
+		return starters[:limit], nil
+	}
+	if len(starters) == limit || a.llm == nil {
+		return starters, nil
+	}
+
+	need := limit - len(starters)
+	prompt := fmt.Sprintf(
+		"%s\n\nПредложи %d коротких follow-up вопросов, которые пользователь может задать после ответа по теме \"%s\". По одному вопросу на строку, без нумерации.",
+		a.kb.Context(), need, intent,
+	)
+
+	generated, err := a.llm.Generate(ctx, prompt)
+	if err != nil {
+		log.Printf("prompt-starters: модель недоступна, возвращаем только заготовки из базы знаний: %v", err)
+		return starters, nil
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(generated), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		starters = append(starters, line)
+		if len(starters) == limit {
+			break
+		}
+	}
+
+	return starters, nil
+}
+
+func (a *SupportAgent) escalateToHuman(query Query) Response {
+	select {
+	case a.humanQueue <- query:
+		log.Printf("Запрос %s передан человеку-оператору", query.ID)
+		return Response{
+			QueryID: query.ID,
+			Text:    "Ваш запрос передан специалисту поддержки.",
+			Source:  "human",
+		}
+	default:
+		log.Printf("Очередь к оператору заполнена, отправляем стандартный ответ")
+		return Response{
+			QueryID: query.ID,
+			Text:    "Все операторы заняты. Попробуйте переформулировать вопрос.",
+			Source:  "ai",
+		}
+	}
+}
+
 // Запускаем обработчик для человека-оператора
 func (a *SupportAgent) StartHumanWorker(ctx context.Context) {
 	go func() {
@@ -189,21 +518,37 @@ func (a *SupportAgent) StartHumanWorker(ctx context.Context) {
 	}()
 }
 
+// defaultTaskRetention - срок хранения результата задачи, когда вызывающий
+// код не запросил собственный через ProcessWithRetention.
+const defaultTaskRetention = 10 * time.Minute
+
 // Система обработки запросов с поддержкой конкурентности
 type AISupport struct {
-	agent      *SupportAgent
-	workers    int
-	queries    chan Query
-	responses  map[string]chan Response
-	responseMu sync.Mutex
+	agent        *SupportAgent
+	workers      int
+	queries      chan Query
+	responses    map[string][]chan Response
+	responseMu   sync.Mutex
+	store        TaskStore
+	resultWriter ResultWriter
+	requestsLog  *RequestsLog
 }
 
-func NewAISupport(agent *SupportAgent, workers int) *AISupport {
+// WithRequestsLog подключает журнал запросов - каждая обработанная задача
+// будет неблокирующе записана в него.
+func (s *AISupport) WithRequestsLog(rl *RequestsLog) *AISupport {
+	s.requestsLog = rl
+	return s
+}
+
+func NewAISupport(agent *SupportAgent, workers int, store TaskStore) *AISupport {
 	return &AISupport{
-		agent:     agent,
-		workers:   workers,
-		queries:   make(chan Query, 100),
-		responses: make(map[string]chan Response),
+		agent:        agent,
+		workers:      workers,
+		queries:      make(chan Query, 100),
+		responses:    make(map[string][]chan Response),
+		store:        store,
+		resultWriter: &storeResultWriter{store: store},
 	}
 }
 
@@ -217,6 +562,54 @@ func (s *AISupport) Start(ctx context.Context) {
 	}
 }
 
+// transportIntents перечисляет все subject'ы, на которые воркер с
+// транспортом должен подписаться - по одному на известный интент плюс
+// "unknown" для запросов, которые NLP не смог классифицировать на
+// стороне отправителя.
+var transportIntents = []Intent{
+	IntentGreeting, IntentHelp, IntentPricing, IntentTechnical, IntentBilling, IntentUnknown,
+}
+
+// StartTransport подписывается на subject'ы вида "support.query.<intent>",
+// так что запросы, опубликованные с других процессов, обрабатываются этим
+// экземпляром AISupport, а ответы публикуются обратно на QueueCallback.
+// Это позволяет нескольким процессам SupportAgent делить нагрузку, не
+// используя общую in-process очередь s.queries.
+//
+// Запросы прогоняются через ProcessWithRetention (а не напрямую через
+// SupportAgent), поэтому трафик, пришедший по транспорту, получает те же
+// гарантии, что и локальные вызовы Process: запись в TaskStore, срок
+// хранения результата, идемпотентные повторы и журнал RequestsLog.
+func (s *AISupport) StartTransport(ctx context.Context, transport Transport, timeout time.Duration) error {
+	handler := func(callCtx context.Context, env Envelope) Response {
+		log.Printf("Транспорт: получен запрос %s от %s", env.Query.ID, env.Header.CallFrom)
+
+		resp, err := s.ProcessWithRetention(callCtx, env.Query, timeout, defaultTaskRetention)
+		if err != nil {
+			log.Printf("Транспорт: ошибка обработки запроса %s: %v", env.Query.ID, err)
+			return Response{QueryID: env.Query.ID, Text: err.Error(), Source: "transport-error"}
+		}
+
+		if resp.Stream != nil {
+			var full strings.Builder
+			for token := range resp.Stream {
+				full.WriteString(token)
+			}
+			resp.Text = full.String()
+			resp.Stream = nil
+		}
+
+		return resp
+	}
+
+	for _, intent := range transportIntents {
+		if err := transport.Subscribe(ctx, subjectForIntent(intent), handler); err != nil {
+			return fmt.Errorf("не удалось подписаться на интент %s: %w", intent, err)
+		}
+	}
+	return nil
+}
+
 func (s *AISupport) worker(ctx context.Context, id int) {
 	log.Printf("Запущен воркер %d", id)
 
@@ -228,63 +621,236 @@ func (s *AISupport) worker(ctx context.Context, id int) {
 		case query := <-s.queries:
 			log.Printf("Воркер %d обрабатывает запрос: %s", id, query.ID)
 
-			// Обрабатываем запрос
-			response := s.agent.ProcessQuery(query)
+			enqueuedAt := time.Now()
+			if task, err := s.store.Get(ctx, query.ID); err == nil {
+				enqueuedAt = task.CreatedAt
+				task.Status = TaskActive
+				_ = s.store.Save(ctx, task)
+			}
 
-			// Отправляем ответ
-			s.responseMu.Lock()
-			if ch, ok := s.responses[query.ID]; ok {
-				ch <- response
-				delete(s.responses, query.ID)
+			// Обрабатываем запрос - интент определяется один раз и
+			// используется и для ответа, и для записи в журнал запросов,
+			// чтобы они не могли разойтись из-за конкурентного AddKeyword
+			intent, response := s.agent.ProcessQueryWithIntent(ctx, query)
+			response.Latency = time.Since(enqueuedAt)
+
+			if response.Source == "llm" && response.Stream != nil {
+				// Текст ответа LLM появляется только по мере вычитывания
+				// Stream, поэтому задачу нельзя пометить завершённой прямо
+				// сейчас - иначе TaskInfo/ListTasks и идемпотентный повтор
+				// будут годами показывать пустой Result.Text. Пропускаем
+				// поток к получателю и одновременно копим его в буфер,
+				// чтобы сохранить итоговый текст, когда он весь вычитан.
+				response.Stream = s.captureAndForward(ctx, query, intent, response, enqueuedAt)
 			} else {
-				log.Printf("Предупреждение: канал для ответа %s не найден", query.ID)
+				status := TaskCompleted
+				if response.Source == "human" {
+					status = TaskEscalated
+				}
+				s.finishTask(ctx, query, intent, response, status)
 			}
-			s.responseMu.Unlock()
+
+			// Отправляем ответ всем локальным вызовам Process, ожидающим
+			// эту задачу (их может быть несколько, если запрос с тем же
+			// ID пришёл повторно, пока исходный ещё обрабатывался)
+			s.deliverResponse(query.ID, response)
 		}
 	}
 }
 
-// Обработка запроса с таймаутом
-func (s *AISupport) Process(query Query, timeout time.Duration) (Response, error) {
-	// Создаем канал для ответа
-	respChan := make(chan Response, 1)
+// registerWaiter регистрирует канал, в который будет отправлен результат
+// задачи queryID, когда он появится - независимо от того, эта ли задача
+// только что поставлена в очередь, или уже обрабатывается воркером после
+// повторного вызова Process с тем же ID.
+func (s *AISupport) registerWaiter(queryID string) chan Response {
+	ch := make(chan Response, 1)
 
-	// Регистрируем канал для получения ответа
 	s.responseMu.Lock()
-	s.responses[query.ID] = respChan
+	s.responses[queryID] = append(s.responses[queryID], ch)
 	s.responseMu.Unlock()
 
+	return ch
+}
+
+// unregisterWaiter убирает канал, оставленный registerWaiter, если ответ
+// так и не понадобился (например, истёк таймаут ожидания).
+func (s *AISupport) unregisterWaiter(queryID string, ch chan Response) {
+	s.responseMu.Lock()
+	defer s.responseMu.Unlock()
+
+	waiters := s.responses[queryID]
+	for i, w := range waiters {
+		if w == ch {
+			s.responses[queryID] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(s.responses[queryID]) == 0 {
+		delete(s.responses, queryID)
+	}
+}
+
+// deliverResponse рассылает готовый ответ всем зарегистрированным
+// ожидающим вызовам Process для этой задачи.
+func (s *AISupport) deliverResponse(queryID string, response Response) {
+	s.responseMu.Lock()
+	waiters := s.responses[queryID]
+	delete(s.responses, queryID)
+	s.responseMu.Unlock()
+
+	for _, ch := range waiters {
+		ch <- response
+	}
+}
+
+// finishTask сохраняет итоговый результат задачи и, если подключен,
+// пишет запись в журнал запросов.
+func (s *AISupport) finishTask(ctx context.Context, query Query, intent Intent, response Response, status TaskStatus) {
+	if err := s.resultWriter.WriteFinal(ctx, query.ID, response, status); err != nil {
+		log.Printf("Предупреждение: не удалось сохранить результат задачи %s: %v", query.ID, err)
+	}
+
+	if s.requestsLog != nil {
+		s.requestsLog.Enqueue(LogEntry{
+			QueryID:        query.ID,
+			UserID:         query.UserID,
+			Text:           query.Text,
+			DetectedIntent: intent,
+			ResponseText:   response.Text,
+			Source:         response.Source,
+			LatencyMs:      response.Latency.Milliseconds(),
+			Escalated:      status == TaskEscalated,
+			CreatedAt:      time.Now(),
+		})
+	}
+}
+
+// captureAndForward передаёт токены исходного потока вызывающему коду
+// без изменений, одновременно накапливая их в буфер. Как только источник
+// закрывает канал, накопленный текст сохраняется через finishTask -
+// только теперь задача помечается TaskCompleted вместе с реальным
+// текстом ответа, а не пустой строкой.
+func (s *AISupport) captureAndForward(ctx context.Context, query Query, intent Intent, response Response, enqueuedAt time.Time) <-chan string {
+	source := response.Stream
+	out := make(chan string)
+
+	go func() {
+		defer close(out)
+
+		var full strings.Builder
+		for token := range source {
+			full.WriteString(token)
+			out <- token
+		}
+
+		final := response
+		final.Text = full.String()
+		final.Stream = nil
+		final.Latency = time.Since(enqueuedAt)
+		s.finishTask(ctx, query, intent, final, TaskCompleted)
+	}()
+
+	return out
+}
+
+// defaultProcessTimeout используется Bot.Loop, когда вызывающий код
+// не уточняет собственный таймаут.
+const defaultProcessTimeout = 5 * time.Second
+
+// Process обрабатывает запрос с таймаутом и сроком хранения результата по
+// умолчанию. Для распределённого хранилища задач (например, Redis) с
+// собственным сроком хранения используйте ProcessWithRetention.
+func (s *AISupport) Process(query Query, timeout time.Duration) (Response, error) {
+	return s.ProcessWithRetention(context.Background(), query, timeout, defaultTaskRetention)
+}
+
+// ProcessWithRetention оборачивает запрос в задачу: если задача с таким же
+// ID уже завершена в пределах окна хранения, результат возвращается без
+// повторного прогона NLP (идемпотентный повтор).
+func (s *AISupport) ProcessWithRetention(ctx context.Context, query Query, timeout, retention time.Duration) (Response, error) {
+	if existing, err := s.store.Get(ctx, query.ID); err == nil {
+		switch existing.Status {
+		case TaskCompleted, TaskFailed, TaskEscalated:
+			log.Printf("Задача %s уже обработана (%s), возвращаем сохранённый результат", query.ID, existing.Status)
+			if existing.Result != nil {
+				return *existing.Result, nil
+			}
+			return Response{}, fmt.Errorf("задача %s завершилась с ошибкой: %s", query.ID, existing.Error)
+		case TaskPending, TaskActive:
+			// Задача с этим ID уже в работе (типичная ситуация при
+			// повторном вызове после таймаута на стороне клиента) -
+			// просто подписываемся на результат, не ставя запрос в
+			// очередь второй раз.
+			log.Printf("Задача %s уже в очереди/обрабатывается (%s), ждём результат без повторной постановки", query.ID, existing.Status)
+			return s.awaitResponse(query.ID, s.registerWaiter(query.ID), timeout)
+		}
+	}
+
+	task := &TaskInfo{
+		ID:        query.ID,
+		UserID:    query.UserID,
+		Status:    TaskPending,
+		CreatedAt: time.Now(),
+		Retention: retention,
+	}
+	if err := s.store.Save(ctx, task); err != nil {
+		return Response{}, fmt.Errorf("не удалось создать задачу %s: %w", query.ID, err)
+	}
+
+	respChan := s.registerWaiter(query.ID)
+
 	// Отправляем запрос на обработку
 	select {
 	case s.queries <- query:
 		log.Printf("Запрос %s добавлен в очередь обработки", query.ID)
 	default:
-		s.responseMu.Lock()
-		delete(s.responses, query.ID)
-		s.responseMu.Unlock()
+		s.unregisterWaiter(query.ID, respChan)
+		_ = s.resultWriter.WriteFinal(ctx, query.ID, Response{}, TaskFailed)
 		return Response{}, fmt.Errorf("система перегружена")
 	}
 
-	// Ожидаем ответ с таймаутом
+	return s.awaitResponse(query.ID, respChan, timeout)
+}
+
+// awaitResponse ждёт результат задачи queryID на respChan не дольше
+// timeout, снимая регистрацию канала, если время вышло.
+func (s *AISupport) awaitResponse(queryID string, respChan chan Response, timeout time.Duration) (Response, error) {
 	select {
 	case resp := <-respChan:
-		log.Printf("Получен ответ на запрос %s от %s", query.ID, resp.Source)
+		log.Printf("Получен ответ на запрос %s от %s", queryID, resp.Source)
 		return resp, nil
 	case <-time.After(timeout):
-		log.Printf("Таймаут ожидания ответа на запрос %s", query.ID)
-		s.responseMu.Lock()
-		delete(s.responses, query.ID)
-		s.responseMu.Unlock()
+		log.Printf("Таймаут ожидания ответа на запрос %s", queryID)
+		s.unregisterWaiter(queryID, respChan)
 		return Response{}, fmt.Errorf("таймаут ожидания ответа")
 	}
 }
 
+// TaskInfo возвращает текущее состояние задачи по её ID - для опроса
+// статуса долгих запросов без повторной блокировки на Process.
+func (s *AISupport) TaskInfo(ctx context.Context, id string) (*TaskInfo, error) {
+	return s.store.Get(ctx, id)
+}
+
+// ListTasks возвращает задачи, подходящие под filter - используется
+// операторами для аудита и ручного разбора очереди.
+func (s *AISupport) ListTasks(ctx context.Context, filter TaskFilter) ([]*TaskInfo, error) {
+	return s.store.List(ctx, filter)
+}
+
 func main() {
 	// Инициализируем компоненты
 	kb := NewKnowledgeBase()
 	nlp := NewNLPProcessor()
-	agent := NewSupportAgent(nlp, kb)
-	support := NewAISupport(agent, 5) // 5 параллельных обработчиков
+	agent := NewSupportAgent(nlp, kb).WithModel(NewOllamaModel("http://localhost:11434", "llama3"))
+	support := NewAISupport(agent, 5, NewMemoryTaskStore()) // 5 параллельных обработчиков
+
+	requestsLog, err := NewRequestsLog("requests_log.sqlite")
+	if err != nil {
+		log.Fatalf("Не удалось инициализировать журнал запросов: %v", err)
+	}
+	defer requestsLog.Close()
+	support.WithRequestsLog(requestsLog)
 
 	// Запускаем систему
 	ctx, cancel := context.WithCancel(context.Background())
@@ -292,6 +858,13 @@ func main() {
 
 	support.Start(ctx)
 
+	// Запускаем HTTP API для подсказок follow-up вопросов
+	go func() {
+		if err := http.ListenAndServe(":8080", NewHTTPMux(agent)); err != nil {
+			log.Printf("HTTP сервер остановлен: %v", err)
+		}
+	}()
+
 	// Примеры запросов
 	queries := []Query{
 		{ID: "q1", UserID: "u1", Text: "Привет, как дела?"},
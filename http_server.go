@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// promptStarterRequest - тело POST /prompt-starter.
+type promptStarterRequest struct {
+	Intent Intent `json:"intent"`
+	Limit  int    `json:"limit"`
+}
+
+type promptStarterResponse struct {
+	Starters []string `json:"starters"`
+}
+
+// NewHTTPMux собирает HTTP-роутер для обращений к SupportAgent со
+// стороны фронтендов (кнопки с подсказками, виджеты и т.п.).
+func NewHTTPMux(agent *SupportAgent) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/prompt-starter", promptStarterHandler(agent))
+	return mux
+}
+
+func promptStarterHandler(agent *SupportAgent) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "метод не поддерживается", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req promptStarterRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "некорректное тело запроса", http.StatusBadRequest)
+			return
+		}
+		if req.Limit == 0 {
+			req.Limit = 5
+		}
+
+		starters, err := agent.PromptStarters(r.Context(), req.Intent, req.Limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(promptStarterResponse{Starters: starters}); err != nil {
+			log.Printf("prompt-starter: не удалось записать ответ: %v", err)
+		}
+	}
+}
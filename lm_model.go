@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Model - интерфейс для языковой модели, используемой как фолбэк,
+// когда NLP не смог определить интент запроса.
+type Model interface {
+	Generate(ctx context.Context, prompt string) (string, error)
+	GenerateStream(ctx context.Context, prompt string) (<-chan string, error)
+}
+
+// ModelConfidence позволяет моделям сигнализировать о низкой уверенности
+// в ответе, чтобы SupportAgent мог эскалировать запрос человеку.
+type ModelConfidence struct {
+	Text       string
+	Confidence float64
+}
+
+const lowConfidenceThreshold = 0.4
+
+// uncertaintyPhrases - обороты, которыми модель обычно сигнализирует, что
+// она не знает ответа, вместо того чтобы явно возвращать ошибку.
+var uncertaintyPhrases = []string{
+	"не знаю", "не уверен", "затрудняюсь ответить", "не могу помочь", "не располагаю",
+}
+
+// estimateConfidence - грубая эвристика уверенности в ответе модели:
+// пустой ответ или явные обороты неуверенности получают низкий скор,
+// иначе считаем ответ уверенным.
+func estimateConfidence(text string) float64 {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return 0
+	}
+
+	lower := strings.ToLower(trimmed)
+	for _, phrase := range uncertaintyPhrases {
+		if strings.Contains(lower, phrase) {
+			return 0.2
+		}
+	}
+
+	return 0.9
+}
+
+// streamFromText оборачивает уже сгенерированный текст в канал токенов,
+// чтобы вызывающему коду (например, chat.Bot) не нужно было различать
+// потоковые и непотоковые ответы модели.
+func streamFromText(text string) <-chan string {
+	out := make(chan string)
+
+	go func() {
+		defer close(out)
+		for _, word := range strings.SplitAfter(text, " ") {
+			if word == "" {
+				continue
+			}
+			out <- word
+		}
+	}()
+
+	return out
+}
+
+// AzureModel - реализация Model поверх Azure OpenAI.
+type AzureModel struct {
+	Endpoint   string
+	Deployment string
+	APIKey     string
+	httpClient *http.Client
+}
+
+func NewAzureModel(endpoint, deployment, apiKey string) *AzureModel {
+	return &AzureModel{
+		Endpoint:   endpoint,
+		Deployment: deployment,
+		APIKey:     apiKey,
+		httpClient: &http.Client{},
+	}
+}
+
+type azureChatRequest struct {
+	Messages []azureChatMessage `json:"messages"`
+}
+
+type azureChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type azureChatResponse struct {
+	Choices []struct {
+		Message azureChatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+func (m *AzureModel) Generate(ctx context.Context, prompt string) (string, error) {
+	url := fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=2024-02-15-preview", m.Endpoint, m.Deployment)
+
+	body, err := json.Marshal(azureChatRequest{
+		Messages: []azureChatMessage{{Role: "user", Content: prompt}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("azure: не удалось сериализовать запрос: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("azure: не удалось создать запрос: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("api-key", m.APIKey)
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("azure: ошибка запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("azure: неожиданный статус %d", resp.StatusCode)
+	}
+
+	var parsed azureChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return "", fmt.Errorf("azure: не удалось разобрать ответ: %w", err)
+	}
+	if len(parsed.Choices) == 0 {
+		return "", fmt.Errorf("azure: пустой ответ модели")
+	}
+
+	return parsed.Choices[0].Message.Content, nil
+}
+
+func (m *AzureModel) GenerateStream(ctx context.Context, prompt string) (<-chan string, error) {
+	out := make(chan string)
+
+	go func() {
+		defer close(out)
+
+		text, err := m.Generate(ctx, prompt)
+		if err != nil {
+			log.Printf("azure: ошибка генерации потока: %v", err)
+			return
+		}
+
+		for _, word := range bytes.SplitAfter([]byte(text), []byte(" ")) {
+			select {
+			case <-ctx.Done():
+				return
+			case out <- string(word):
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// OllamaModel - реализация Model поверх локального Ollama-сервера,
+// использующего потоковый NDJSON API /api/generate.
+type OllamaModel struct {
+	BaseURL    string
+	ModelName  string
+	httpClient *http.Client
+}
+
+func NewOllamaModel(baseURL, modelName string) *OllamaModel {
+	return &OllamaModel{
+		BaseURL:    baseURL,
+		ModelName:  modelName,
+		httpClient: &http.Client{},
+	}
+}
+
+type ollamaGenerateRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+	Stream bool   `json:"stream"`
+}
+
+type ollamaGenerateChunk struct {
+	Response string `json:"response"`
+	Done     bool   `json:"done"`
+}
+
+func (m *OllamaModel) Generate(ctx context.Context, prompt string) (string, error) {
+	stream, err := m.generate(ctx, prompt, false)
+	if err != nil {
+		return "", err
+	}
+
+	var result bytes.Buffer
+	for chunk := range stream {
+		result.WriteString(chunk)
+	}
+	return result.String(), nil
+}
+
+func (m *OllamaModel) GenerateStream(ctx context.Context, prompt string) (<-chan string, error) {
+	return m.generate(ctx, prompt, true)
+}
+
+func (m *OllamaModel) generate(ctx context.Context, prompt string, stream bool) (<-chan string, error) {
+	body, err := json.Marshal(ollamaGenerateRequest{
+		Model:  m.ModelName,
+		Prompt: prompt,
+		Stream: stream,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ollama: не удалось сериализовать запрос: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.BaseURL+"/api/generate", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("ollama: не удалось создать запрос: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ollama: ошибка запроса: %w", err)
+	}
+
+	out := make(chan string)
+	go func() {
+		defer close(out)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var chunk ollamaGenerateChunk
+			if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+				log.Printf("ollama: не удалось разобрать строку ответа: %v", err)
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case out <- chunk.Response:
+			}
+
+			if chunk.Done {
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
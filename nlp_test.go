@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestDetectIntent(t *testing.T) {
+	p := NewNLPProcessor()
+
+	cases := []struct {
+		name string
+		text string
+		want Intent
+	}{
+		{name: "greeting", text: "Добрый день", want: IntentGreeting},
+		{name: "help", text: "помогите мне пожалуйста", want: IntentHelp},
+		{name: "negated help is not boosted", text: "не помощь", want: IntentUnknown},
+		{name: "bigram keyword with negation word as its own first token", text: "у меня не работает авторизация", want: IntentTechnical},
+		{name: "unknown", text: "расскажите анекдот про котика", want: IntentUnknown},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := p.DetectIntent(tc.text)
+			if got != tc.want {
+				t.Errorf("DetectIntent(%q) = %s, хотели %s", tc.text, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDetectIntentScoredNegationFlipsSign(t *testing.T) {
+	p := NewNLPProcessor()
+
+	scores := p.DetectIntentScored("не помощь")
+
+	for _, s := range scores {
+		if s.Intent == IntentHelp && s.Confidence > 0 {
+			t.Fatalf("негированное ключевое слово не должно давать положительный скор по IntentHelp, получили %.2f", s.Confidence)
+		}
+	}
+}
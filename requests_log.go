@@ -0,0 +1,178 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// LogEntry - одна строка в журнале обработанных запросов.
+type LogEntry struct {
+	QueryID        string
+	UserID         string
+	Text           string
+	DetectedIntent Intent
+	ResponseText   string
+	Source         string
+	LatencyMs      int64
+	Escalated      bool
+	Error          string
+	CreatedAt      time.Time
+}
+
+// logError - запись о неудачной попытке сохранить LogEntry, пишется во
+// вторичную таблицу, чтобы сбой журналирования не приводил к потере сигнала.
+type logError struct {
+	QueryID   string
+	Message   string
+	CreatedAt time.Time
+}
+
+// RequestsLog пишет каждую пару Query/Response в SQLite в фоновой
+// горутине, так что журналирование никогда не блокирует AISupport.worker.
+type RequestsLog struct {
+	db        *sql.DB
+	entries   chan LogEntry
+	errors    chan logError
+	done      chan struct{}
+	errorDone chan struct{}
+}
+
+func NewRequestsLog(dsn string) (*RequestsLog, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("requests log: не удалось открыть базу %s: %w", dsn, err)
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS requests_log (
+			query_id        TEXT PRIMARY KEY,
+			user_id         TEXT,
+			text            TEXT,
+			detected_intent TEXT,
+			response_text   TEXT,
+			source          TEXT,
+			latency_ms      INTEGER,
+			escalated       INTEGER,
+			error           TEXT,
+			created_at      DATETIME
+		)`); err != nil {
+		return nil, fmt.Errorf("requests log: не удалось создать таблицу requests_log: %w", err)
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS requests_log_errors (
+			query_id   TEXT,
+			message    TEXT,
+			created_at DATETIME
+		)`); err != nil {
+		return nil, fmt.Errorf("requests log: не удалось создать таблицу requests_log_errors: %w", err)
+	}
+
+	rl := &RequestsLog{
+		db:        db,
+		entries:   make(chan LogEntry, 256),
+		errors:    make(chan logError, 64),
+		done:      make(chan struct{}),
+		errorDone: make(chan struct{}),
+	}
+
+	go rl.runEntryWriter()
+	go rl.runErrorWriter()
+
+	return rl, nil
+}
+
+// Enqueue ставит запись в очередь на запись и немедленно возвращается -
+// если буфер заполнен, запись отбрасывается с предупреждением в лог, а не
+// блокирует горячий путь воркера.
+func (rl *RequestsLog) Enqueue(entry LogEntry) {
+	select {
+	case rl.entries <- entry:
+	default:
+		log.Printf("requests log: буфер заполнен, запись %s отброшена", entry.QueryID)
+	}
+}
+
+func (rl *RequestsLog) runEntryWriter() {
+	for entry := range rl.entries {
+		_, err := rl.db.Exec(
+			`INSERT OR REPLACE INTO requests_log
+				(query_id, user_id, text, detected_intent, response_text, source, latency_ms, escalated, error, created_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			entry.QueryID, entry.UserID, entry.Text, entry.DetectedIntent, entry.ResponseText,
+			entry.Source, entry.LatencyMs, entry.Escalated, entry.Error, entry.CreatedAt,
+		)
+		if err != nil {
+			select {
+			case rl.errors <- logError{QueryID: entry.QueryID, Message: err.Error(), CreatedAt: time.Now()}:
+			default:
+				log.Printf("requests log: не удалось записать ни запись %s, ни ошибку о ней: %v", entry.QueryID, err)
+			}
+		}
+	}
+	close(rl.done)
+}
+
+func (rl *RequestsLog) runErrorWriter() {
+	for logErr := range rl.errors {
+		if _, err := rl.db.Exec(
+			`INSERT INTO requests_log_errors (query_id, message, created_at) VALUES (?, ?, ?)`,
+			logErr.QueryID, logErr.Message, logErr.CreatedAt,
+		); err != nil {
+			log.Printf("requests log: не удалось записать ошибку журналирования для %s: %v", logErr.QueryID, err)
+		}
+	}
+	close(rl.errorDone)
+}
+
+// Since возвращает записи, созданные после t.
+func (rl *RequestsLog) Since(t time.Time) ([]LogEntry, error) {
+	rows, err := rl.db.Query(`SELECT query_id, user_id, text, detected_intent, response_text, source, latency_ms, escalated, error, created_at
+		FROM requests_log WHERE created_at > ? ORDER BY created_at`, t)
+	if err != nil {
+		return nil, fmt.Errorf("requests log: не удалось выполнить запрос Since: %w", err)
+	}
+	defer rows.Close()
+
+	return scanLogEntries(rows)
+}
+
+// ByUser возвращает все записи для указанного пользователя.
+func (rl *RequestsLog) ByUser(userID string) ([]LogEntry, error) {
+	rows, err := rl.db.Query(`SELECT query_id, user_id, text, detected_intent, response_text, source, latency_ms, escalated, error, created_at
+		FROM requests_log WHERE user_id = ? ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("requests log: не удалось выполнить запрос ByUser: %w", err)
+	}
+	defer rows.Close()
+
+	return scanLogEntries(rows)
+}
+
+func scanLogEntries(rows *sql.Rows) ([]LogEntry, error) {
+	var result []LogEntry
+	for rows.Next() {
+		var e LogEntry
+		if err := rows.Scan(&e.QueryID, &e.UserID, &e.Text, &e.DetectedIntent, &e.ResponseText,
+			&e.Source, &e.LatencyMs, &e.Escalated, &e.Error, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("requests log: не удалось разобрать строку: %w", err)
+		}
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+// Close останавливает запись и дожидается обработки буфера - в том числе
+// runErrorWriter, чтобы db.Close() не выполнился, пока в нём ещё может
+// быть незавершённая запись об ошибке.
+func (rl *RequestsLog) Close() error {
+	close(rl.entries)
+	<-rl.done
+	close(rl.errors)
+	<-rl.errorDone
+	return rl.db.Close()
+}
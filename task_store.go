@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// TaskStatus - состояние задачи в её жизненном цикле.
+type TaskStatus string
+
+const (
+	TaskPending   TaskStatus = "pending"
+	TaskActive    TaskStatus = "active"
+	TaskCompleted TaskStatus = "completed"
+	TaskFailed    TaskStatus = "failed"
+	TaskEscalated TaskStatus = "escalated"
+)
+
+// TaskInfo - персистентное представление одного запроса, позволяющее
+// опрашивать статус и результат без повторного прогона NLP.
+type TaskInfo struct {
+	ID          string
+	UserID      string
+	Status      TaskStatus
+	CreatedAt   time.Time
+	CompletedAt time.Time
+	Result      *Response
+	Retention   time.Duration
+	Error       string
+}
+
+// expired сообщает, истёк ли срок хранения задачи относительно now.
+func (t *TaskInfo) expired(now time.Time) bool {
+	if t.Retention <= 0 || t.CompletedAt.IsZero() {
+		return false
+	}
+	return now.After(t.CompletedAt.Add(t.Retention))
+}
+
+// TaskFilter используется операторами для выборки задач в ListTasks.
+type TaskFilter struct {
+	UserID string
+	Status TaskStatus
+}
+
+func (f TaskFilter) matches(t *TaskInfo) bool {
+	if f.UserID != "" && f.UserID != t.UserID {
+		return false
+	}
+	if f.Status != "" && f.Status != t.Status {
+		return false
+	}
+	return true
+}
+
+// TaskStore хранит TaskInfo так, чтобы результат можно было забрать в
+// пределах окна Retention без повторной обработки запроса.
+type TaskStore interface {
+	Save(ctx context.Context, task *TaskInfo) error
+	Get(ctx context.Context, id string) (*TaskInfo, error)
+	List(ctx context.Context, filter TaskFilter) ([]*TaskInfo, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// ResultWriter - то, во что воркеры пишут промежуточные и финальные
+// результаты обработки задачи.
+type ResultWriter interface {
+	WritePartial(ctx context.Context, taskID string, partial string) error
+	WriteFinal(ctx context.Context, taskID string, resp Response, status TaskStatus) error
+}
+
+// MemoryTaskStore - реализация TaskStore поверх map, с ленивой очисткой
+// просроченных задач при каждом обращении.
+type MemoryTaskStore struct {
+	mu    sync.RWMutex
+	tasks map[string]*TaskInfo
+}
+
+func NewMemoryTaskStore() *MemoryTaskStore {
+	return &MemoryTaskStore{tasks: make(map[string]*TaskInfo)}
+}
+
+func (s *MemoryTaskStore) Save(ctx context.Context, task *TaskInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks[task.ID] = task
+	return nil
+}
+
+func (s *MemoryTaskStore) Get(ctx context.Context, id string) (*TaskInfo, error) {
+	s.mu.RLock()
+	task, ok := s.tasks[id]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("задача %s не найдена", id)
+	}
+	if task.expired(time.Now()) {
+		s.mu.Lock()
+		delete(s.tasks, id)
+		s.mu.Unlock()
+		return nil, fmt.Errorf("задача %s не найдена", id)
+	}
+	return task, nil
+}
+
+func (s *MemoryTaskStore) List(ctx context.Context, filter TaskFilter) ([]*TaskInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	result := make([]*TaskInfo, 0)
+	for _, task := range s.tasks {
+		if task.expired(now) {
+			continue
+		}
+		if filter.matches(task) {
+			result = append(result, task)
+		}
+	}
+	return result, nil
+}
+
+func (s *MemoryTaskStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tasks, id)
+	return nil
+}
+
+// storeResultWriter - реализация ResultWriter по умолчанию, сохраняющая
+// результаты обработки прямо в TaskStore.
+type storeResultWriter struct {
+	store TaskStore
+}
+
+func (w *storeResultWriter) WritePartial(ctx context.Context, taskID string, partial string) error {
+	log.Printf("Промежуточный результат задачи %s: %s", taskID, partial)
+	return nil
+}
+
+func (w *storeResultWriter) WriteFinal(ctx context.Context, taskID string, resp Response, status TaskStatus) error {
+	task, err := w.store.Get(ctx, taskID)
+	if err != nil {
+		task = &TaskInfo{ID: taskID, CreatedAt: time.Now()}
+	}
+
+	task.Status = status
+	task.CompletedAt = time.Now()
+	task.Result = &resp
+	if status == TaskFailed {
+		task.Error = resp.Text
+	}
+
+	return w.store.Save(ctx, task)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisTaskStore - реализация TaskStore поверх Redis, подходящая для
+// нескольких процессов AISupport, делящих одно хранилище задач.
+// Ключ задачи хранится с TTL, равным Retention, так что Redis сам
+// вычищает просроченные записи.
+type RedisTaskStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisTaskStore(client *redis.Client) *RedisTaskStore {
+	return &RedisTaskStore{client: client, prefix: "support:task:"}
+}
+
+func (s *RedisTaskStore) key(id string) string {
+	return s.prefix + id
+}
+
+func (s *RedisTaskStore) Save(ctx context.Context, task *TaskInfo) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("redis task store: не удалось сериализовать задачу: %w", err)
+	}
+
+	ttl := task.Retention
+	if ttl <= 0 {
+		ttl = 0 // без TTL, хранить пока не удалят явно
+	}
+
+	if err := s.client.Set(ctx, s.key(task.ID), data, ttl).Err(); err != nil {
+		return fmt.Errorf("redis task store: не удалось сохранить задачу %s: %w", task.ID, err)
+	}
+	return nil
+}
+
+func (s *RedisTaskStore) Get(ctx context.Context, id string) (*TaskInfo, error) {
+	data, err := s.client.Get(ctx, s.key(id)).Bytes()
+	if err == redis.Nil {
+		return nil, fmt.Errorf("задача %s не найдена", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("redis task store: ошибка чтения задачи %s: %w", id, err)
+	}
+
+	var task TaskInfo
+	if err := json.Unmarshal(data, &task); err != nil {
+		return nil, fmt.Errorf("redis task store: не удалось разобрать задачу %s: %w", id, err)
+	}
+	return &task, nil
+}
+
+// List сканирует ключи по префиксу - для больших очередей стоит
+// завести вторичный индекс, но для объёмов этого сервиса SCAN достаточен.
+func (s *RedisTaskStore) List(ctx context.Context, filter TaskFilter) ([]*TaskInfo, error) {
+	var result []*TaskInfo
+	iter := s.client.Scan(ctx, 0, s.prefix+"*", 0).Iterator()
+
+	for iter.Next(ctx) {
+		data, err := s.client.Get(ctx, iter.Val()).Bytes()
+		if err != nil {
+			continue
+		}
+
+		var task TaskInfo
+		if err := json.Unmarshal(data, &task); err != nil {
+			continue
+		}
+		if filter.matches(&task) {
+			result = append(result, &task)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("redis task store: ошибка перебора задач: %w", err)
+	}
+
+	return result, nil
+}
+
+func (s *RedisTaskStore) Delete(ctx context.Context, id string) error {
+	if err := s.client.Del(ctx, s.key(id)).Err(); err != nil {
+		return fmt.Errorf("redis task store: не удалось удалить задачу %s: %w", id, err)
+	}
+	return nil
+}
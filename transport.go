@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Header сопровождает каждый Query, отправленный через Transport, и
+// позволяет воркеру на другой машине знать, кто вызвал и куда слать ответ.
+type Header struct {
+	CallFrom       string
+	CallResponseID string
+	QueueCallback  string
+}
+
+// Envelope - то, что реально летит по шине сообщений: запрос плюс
+// адресная информация для ответа.
+type Envelope struct {
+	Header Header
+	Query  Query
+}
+
+// AcceptFunc решает, разрешено ли обрабатывать запрос от данного
+// вызывающего - позволяет подключить авторизацию поверх Transport.
+type AcceptFunc func(callFrom string) bool
+
+// Transport - абстракция над шиной, на которой несколько процессов
+// AISupport могут делить нагрузку. Реализация должна вызывать handler
+// для каждого входящего Envelope и гарантировать, что Drain завершает
+// подписки, когда ctx отменяется.
+type Transport interface {
+	Subscribe(ctx context.Context, subject string, handler func(context.Context, Envelope) Response) error
+	Publish(ctx context.Context, subject string, resp Response) error
+	// Request - клиентская сторона Subscribe: публикует query как Envelope
+	// на subject (см. subjectForIntent) и дожидается ответа от того
+	// процесса AISupport, который его обработает. Именно этот метод
+	// позволяет одному процессу отправить работу другому через Transport
+	// вместо локальной очереди AISupport.queries.
+	Request(ctx context.Context, subject string, query Query, callFrom string, timeout time.Duration) (Response, error)
+	Close() error
+}
+
+// subjectForIntent строит имя subject'а, на который публикуются запросы
+// данного интента, чтобы воркеры могли подписываться избирательно.
+func subjectForIntent(intent Intent) string {
+	if intent == "" {
+		intent = IntentUnknown
+	}
+	return "support.query." + string(intent)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSTransport - реализация Transport поверх NATS, позволяющая нескольким
+// процессам SupportAgent разбирать очередь запросов с разных машин.
+type NATSTransport struct {
+	conn        *nats.Conn
+	acceptFunc  AcceptFunc
+	callTimeout time.Duration
+
+	mu   sync.Mutex
+	subs []*nats.Subscription
+}
+
+func NewNATSTransport(url string, acceptFunc AcceptFunc, callTimeout time.Duration) (*NATSTransport, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, fmt.Errorf("nats transport: не удалось подключиться к %s: %w", url, err)
+	}
+
+	if acceptFunc == nil {
+		acceptFunc = func(string) bool { return true }
+	}
+
+	return &NATSTransport{conn: conn, acceptFunc: acceptFunc, callTimeout: callTimeout}, nil
+}
+
+// forbiddenResponse - полезная нагрузка, которую получает вызывающий,
+// если acceptFunc отклонил его CallFrom.
+func forbiddenResponse(queryID string) Response {
+	return Response{QueryID: queryID, Text: "доступ запрещён (403)", Source: "transport"}
+}
+
+func (t *NATSTransport) Subscribe(ctx context.Context, subject string, handler func(context.Context, Envelope) Response) error {
+	sub, err := t.conn.Subscribe(subject, func(msg *nats.Msg) {
+		env, err := unmarshalEnvelope(msg.Data)
+		if err != nil {
+			log.Printf("nats transport: не удалось разобрать envelope на %s: %v", subject, err)
+			return
+		}
+
+		// replyTo - куда публиковать ответ: приоритет у явного
+		// QueueCallback из Envelope (нужен для реализаций без встроенного
+		// request/reply), а встроенный inbox NATS (msg.Reply) используется
+		// как запасной вариант для клиентов, вызывающих Request.
+		replyTo := env.Header.QueueCallback
+		if msg.Reply != "" {
+			replyTo = msg.Reply
+		}
+
+		if !t.acceptFunc(env.Header.CallFrom) {
+			log.Printf("nats transport: запрос от %s отклонён", env.Header.CallFrom)
+			_ = t.Publish(ctx, replyTo, forbiddenResponse(env.Query.ID))
+			return
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, t.callTimeout)
+		defer cancel()
+
+		resp := handler(callCtx, env)
+		if err := t.Publish(callCtx, replyTo, resp); err != nil {
+			log.Printf("nats transport: не удалось опубликовать ответ на %s: %v", replyTo, err)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("nats transport: не удалось подписаться на %s: %w", subject, err)
+	}
+
+	t.mu.Lock()
+	t.subs = append(t.subs, sub)
+	t.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		if err := sub.Drain(); err != nil {
+			log.Printf("nats transport: ошибка при остановке подписки %s: %v", subject, err)
+		}
+	}()
+
+	return nil
+}
+
+// Request публикует query как Envelope на subject и дожидается ответа через
+// встроенный в NATS механизм request/reply (msg.Reply), который сервер,
+// подписанный через Subscribe, использует как replyTo для своего ответа.
+func (t *NATSTransport) Request(ctx context.Context, subject string, query Query, callFrom string, timeout time.Duration) (Response, error) {
+	env := Envelope{
+		Header: Header{CallFrom: callFrom, CallResponseID: query.ID},
+		Query:  query,
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	msg, err := t.conn.RequestWithContext(callCtx, subject, marshalEnvelope(env))
+	if err != nil {
+		return Response{}, fmt.Errorf("nats transport: запрос %s на %s не удался: %w", query.ID, subject, err)
+	}
+
+	resp, err := unmarshalResponse(msg.Data)
+	if err != nil {
+		return Response{}, fmt.Errorf("nats transport: не удалось разобрать ответ на запрос %s: %w", query.ID, err)
+	}
+	return resp, nil
+}
+
+func (t *NATSTransport) Publish(ctx context.Context, subject string, resp Response) error {
+	data := marshalResponse(resp)
+	if err := t.conn.Publish(subject, data); err != nil {
+		return fmt.Errorf("nats transport: не удалось опубликовать на %s: %w", subject, err)
+	}
+	return nil
+}
+
+// Close дожидается дренажа всех подписок и закрывает соединение.
+func (t *NATSTransport) Close() error {
+	t.mu.Lock()
+	subs := t.subs
+	t.mu.Unlock()
+
+	for _, sub := range subs {
+		_ = sub.Drain()
+	}
+	t.conn.Close()
+	return nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Поля протокола для Envelope/Header/Query. Сообщения кодируются вручную
+// через protowire, а не через сгенерированный protoc-gen-go код, чтобы не
+// тянуть в сборку protoc - схема ниже является единственным источником
+// истины о номерах полей.
+const (
+	fieldEnvelopeHeader = protowire.Number(1)
+	fieldEnvelopeQuery  = protowire.Number(2)
+
+	fieldHeaderCallFrom       = protowire.Number(1)
+	fieldHeaderCallResponseID = protowire.Number(2)
+	fieldHeaderQueueCallback  = protowire.Number(3)
+
+	fieldQueryID      = protowire.Number(1)
+	fieldQueryUserID  = protowire.Number(2)
+	fieldQueryText    = protowire.Number(3)
+	fieldQueryHistory = protowire.Number(4)
+
+	fieldResponseQueryID   = protowire.Number(1)
+	fieldResponseText      = protowire.Number(2)
+	fieldResponseSource    = protowire.Number(3)
+	fieldResponseLatencyNs = protowire.Number(4)
+)
+
+func marshalHeader(h Header) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, fieldHeaderCallFrom, protowire.BytesType)
+	b = protowire.AppendString(b, h.CallFrom)
+	b = protowire.AppendTag(b, fieldHeaderCallResponseID, protowire.BytesType)
+	b = protowire.AppendString(b, h.CallResponseID)
+	b = protowire.AppendTag(b, fieldHeaderQueueCallback, protowire.BytesType)
+	b = protowire.AppendString(b, h.QueueCallback)
+	return b
+}
+
+func marshalQuery(q Query) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, fieldQueryID, protowire.BytesType)
+	b = protowire.AppendString(b, q.ID)
+	b = protowire.AppendTag(b, fieldQueryUserID, protowire.BytesType)
+	b = protowire.AppendString(b, q.UserID)
+	b = protowire.AppendTag(b, fieldQueryText, protowire.BytesType)
+	b = protowire.AppendString(b, q.Text)
+	for _, turn := range q.History {
+		b = protowire.AppendTag(b, fieldQueryHistory, protowire.BytesType)
+		b = protowire.AppendString(b, turn)
+	}
+	return b
+}
+
+// marshalEnvelope сериализует Envelope в protobuf wire format, чтобы его
+// можно было опубликовать в NATS без зависимости от protoc.
+func marshalEnvelope(env Envelope) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, fieldEnvelopeHeader, protowire.BytesType)
+	b = protowire.AppendBytes(b, marshalHeader(env.Header))
+	b = protowire.AppendTag(b, fieldEnvelopeQuery, protowire.BytesType)
+	b = protowire.AppendBytes(b, marshalQuery(env.Query))
+	return b
+}
+
+// marshalResponse сериализует Response в protobuf wire format. Stream не
+// сериализуется - к моменту публикации ответа по транспорту он уже
+// вычитан вызывающей стороной (см. AISupport.captureAndForward).
+func marshalResponse(resp Response) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, fieldResponseQueryID, protowire.BytesType)
+	b = protowire.AppendString(b, resp.QueryID)
+	b = protowire.AppendTag(b, fieldResponseText, protowire.BytesType)
+	b = protowire.AppendString(b, resp.Text)
+	b = protowire.AppendTag(b, fieldResponseSource, protowire.BytesType)
+	b = protowire.AppendString(b, resp.Source)
+	b = protowire.AppendTag(b, fieldResponseLatencyNs, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(resp.Latency.Nanoseconds()))
+	return b
+}
+
+func unmarshalResponse(data []byte) (Response, error) {
+	var resp Response
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return Response{}, fmt.Errorf("response: некорректный тег: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return Response{}, fmt.Errorf("response: некорректное поле %d: %w", num, protowire.ParseError(n))
+			}
+			data = data[n:]
+
+			switch num {
+			case fieldResponseQueryID:
+				resp.QueryID = string(v)
+			case fieldResponseText:
+				resp.Text = string(v)
+			case fieldResponseSource:
+				resp.Source = string(v)
+			}
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return Response{}, fmt.Errorf("response: некорректное поле %d: %w", num, protowire.ParseError(n))
+			}
+			data = data[n:]
+
+			if num == fieldResponseLatencyNs {
+				resp.Latency = time.Duration(v)
+			}
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return Response{}, fmt.Errorf("response: не удалось пропустить поле %d: %w", num, protowire.ParseError(n))
+			}
+			data = data[n:]
+		}
+	}
+	return resp, nil
+}
+
+func unmarshalHeader(data []byte) (Header, error) {
+	var h Header
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return Header{}, fmt.Errorf("header: некорректный тег: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		if typ != protowire.BytesType {
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return Header{}, fmt.Errorf("header: не удалось пропустить поле %d: %w", num, protowire.ParseError(n))
+			}
+			data = data[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return Header{}, fmt.Errorf("header: некорректное поле %d: %w", num, protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		switch num {
+		case fieldHeaderCallFrom:
+			h.CallFrom = string(v)
+		case fieldHeaderCallResponseID:
+			h.CallResponseID = string(v)
+		case fieldHeaderQueueCallback:
+			h.QueueCallback = string(v)
+		}
+	}
+	return h, nil
+}
+
+func unmarshalQuery(data []byte) (Query, error) {
+	var q Query
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return Query{}, fmt.Errorf("query: некорректный тег: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		if typ != protowire.BytesType {
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return Query{}, fmt.Errorf("query: не удалось пропустить поле %d: %w", num, protowire.ParseError(n))
+			}
+			data = data[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return Query{}, fmt.Errorf("query: некорректное поле %d: %w", num, protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		switch num {
+		case fieldQueryID:
+			q.ID = string(v)
+		case fieldQueryUserID:
+			q.UserID = string(v)
+		case fieldQueryText:
+			q.Text = string(v)
+		case fieldQueryHistory:
+			q.History = append(q.History, string(v))
+		}
+	}
+	return q, nil
+}
+
+// unmarshalEnvelope разбирает байты, сериализованные marshalEnvelope.
+func unmarshalEnvelope(data []byte) (Envelope, error) {
+	var env Envelope
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return Envelope{}, fmt.Errorf("envelope: некорректный тег: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		if typ != protowire.BytesType {
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return Envelope{}, fmt.Errorf("envelope: не удалось пропустить поле %d: %w", num, protowire.ParseError(n))
+			}
+			data = data[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return Envelope{}, fmt.Errorf("envelope: некорректное поле %d: %w", num, protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		switch num {
+		case fieldEnvelopeHeader:
+			h, err := unmarshalHeader(v)
+			if err != nil {
+				return Envelope{}, err
+			}
+			env.Header = h
+		case fieldEnvelopeQuery:
+			q, err := unmarshalQuery(v)
+			if err != nil {
+				return Envelope{}, err
+			}
+			env.Query = q
+		}
+	}
+	return env, nil
+}